@@ -0,0 +1,144 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// Fetcher issues one request against whatever target it was built for
+// and reports how it went. Each Fetcher owns its own connection
+// pool/client so timeouts and keep-alives can be tuned per protocol;
+// worker() calls Fetch once per token from the pacer instead of
+// switching on *fetcher itself.
+type Fetcher interface {
+	Fetch(ctx context.Context) (status string, latency time.Duration, err error)
+}
+
+// fetcherFactory builds a Fetcher for the given target (usually a URL).
+type fetcherFactory func(target string) (Fetcher, error)
+
+// fetcherRegistry maps a --fetcher name to the factory that builds it.
+// New transports register themselves here instead of adding a case to
+// worker's switch statement.
+var fetcherRegistry = map[string]fetcherFactory{
+	"go":    newGoFetcher,
+	"curl":  newCurlFetcher,
+	"noop":  newNoopFetcher,
+	"http2": newHTTP2Fetcher,
+	"h2c":   newH2CFetcher,
+	"http3": newHTTP3Fetcher,
+	"grpc":  newGRPCFetcher,
+}
+
+// splitFetcherFlag splits a --fetcher value of the form "scheme://rest"
+// into the registry name and the target it implies, so that e.g.
+// `--fetcher grpc://localhost:50051` can be used without a separate
+// positional url. A bare name ("go") has no implied target.
+func splitFetcherFlag(s string) (name, target string, hasTarget bool) {
+	i := strings.Index(s, "://")
+	if i < 0 {
+		return s, "", false
+	}
+	name, rest := s[:i], s[i+len("://"):]
+	switch name {
+	case "grpc":
+		// grpc.ClientConn targets are bare host:port, not URLs.
+		target = rest
+	case "h2c":
+		target = "http://" + rest
+	default:
+		target = "https://" + rest
+	}
+	return name, target, true
+}
+
+// newFetcher looks up name in fetcherRegistry and builds a Fetcher for
+// target.
+func newFetcher(name, target string) (Fetcher, error) {
+	factory, ok := fetcherRegistry[name]
+	if !ok {
+		return nil, fmt.Errorf("unrecognized value for --fetcher: %q", name)
+	}
+	return factory(target)
+}
+
+// errStatus turns an error into the same short "status text" hammer has
+// always reported, e.g. "connection refused" rather than the full
+// "Get \"...\": dial tcp ...: connection refused".
+func errStatus(err error) string {
+	parts := strings.Split(err.Error(), ": ")
+	return parts[len(parts)-1]
+}
+
+// doHTTPFetch is shared by the plain HTTP/1.1, HTTP/2, h2c, and HTTP/3
+// fetchers, which differ only in how client is configured.
+func doHTTPFetch(ctx context.Context, client *http.Client, target string) (string, time.Duration, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return "", 0, err
+	}
+	start := time.Now()
+	resp, err := client.Do(req)
+	latency := time.Since(start)
+	if err != nil {
+		return errStatus(err), latency, nil
+	}
+	defer resp.Body.Close()
+	if _, err := ioutil.ReadAll(resp.Body); err != nil {
+		return fmt.Sprintf("Failed to read response body: %v", err), latency, nil
+	}
+	return http.StatusText(resp.StatusCode), latency, nil
+}
+
+// goFetcher issues plain net/http requests, same as hammer always has.
+type goFetcher struct {
+	target string
+	client http.Client
+}
+
+func newGoFetcher(target string) (Fetcher, error) {
+	return &goFetcher{target: target}, nil
+}
+
+func (f *goFetcher) Fetch(ctx context.Context) (string, time.Duration, error) {
+	// requestTimeout() can change request to request, so it's applied
+	// via the per-call context deadline rather than by mutating the
+	// shared client's Timeout field, which every worker goroutine calls
+	// Fetch on concurrently.
+	ctx, cancel := context.WithTimeout(ctx, requestTimeout())
+	defer cancel()
+	return doHTTPFetch(ctx, &f.client, f.target)
+}
+
+// curlFetcher shells out to curl for each request.
+type curlFetcher struct {
+	target string
+}
+
+func newCurlFetcher(target string) (Fetcher, error) {
+	return &curlFetcher{target: target}, nil
+}
+
+func (f *curlFetcher) Fetch(ctx context.Context) (string, time.Duration, error) {
+	start := time.Now()
+	cmd := exec.CommandContext(ctx, "curl", "-s", "-S", f.target)
+	out, _ := cmd.CombinedOutput()
+	return string(out), time.Since(start), nil
+}
+
+// noopFetcher does nothing; it's useful for measuring hammer's own
+// overhead in isolation from any real target.
+type noopFetcher struct{}
+
+func newNoopFetcher(target string) (Fetcher, error) {
+	return noopFetcher{}, nil
+}
+
+func (noopFetcher) Fetch(ctx context.Context) (string, time.Duration, error) {
+	return "Did nothing", 0, nil
+}
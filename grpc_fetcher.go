@@ -0,0 +1,39 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// grpcFetcher calls grpc.health.v1.Health/Check against target, which
+// must be a bare host:port (no scheme) naming a gRPC server.
+type grpcFetcher struct {
+	target string
+	conn   *grpc.ClientConn
+	client healthpb.HealthClient
+}
+
+func newGRPCFetcher(target string) (Fetcher, error) {
+	conn, err := grpc.NewClient(target, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		return nil, fmt.Errorf("dialing %s: %w", target, err)
+	}
+	return &grpcFetcher{target: target, conn: conn, client: healthpb.NewHealthClient(conn)}, nil
+}
+
+func (f *grpcFetcher) Fetch(ctx context.Context) (string, time.Duration, error) {
+	ctx, cancel := context.WithTimeout(ctx, requestTimeout())
+	defer cancel()
+	start := time.Now()
+	resp, err := f.client.Check(ctx, &healthpb.HealthCheckRequest{})
+	latency := time.Since(start)
+	if err != nil {
+		return errStatus(err), latency, nil
+	}
+	return resp.GetStatus().String(), latency, nil
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"flag"
+	"sync"
+	"time"
+)
+
+var windowFlag = flag.Duration("window", time.Second, "sliding window over which the status and latency histograms are reported, e.g. 5s")
+
+// windowSeconds is the number of one-second ring buckets backing the
+// status and latency histograms, derived from --window.
+var windowSeconds int
+
+// statusHistogram is a rolling histogram of status-text counts, backed
+// by a ring of per-second buckets that a single janitor goroutine
+// advances once a second. This replaces the old scheme of spawning a
+// goroutine and a time.After timer for every single completed request,
+// which under high QPS allocated millions of timers; here the cost per
+// tick is O(distinct statuses in the evicted slot), not O(QPS).
+type statusHistogram struct {
+	mu     sync.Mutex
+	ring   []map[string]int
+	head   int
+	totals map[string]int
+}
+
+func newStatusHistogram(ringLen int) *statusHistogram {
+	if ringLen < 1 {
+		ringLen = 1
+	}
+	h := &statusHistogram{
+		ring:   make([]map[string]int, ringLen),
+		totals: make(map[string]int),
+	}
+	for i := range h.ring {
+		h.ring[i] = make(map[string]int)
+	}
+	go h.sweep()
+	return h
+}
+
+// sweep advances the ring once a second, evicting the oldest slot's
+// counts from totals.
+func (h *statusHistogram) sweep() {
+	for range time.Tick(time.Second) {
+		h.mu.Lock()
+		h.head = (h.head + 1) % len(h.ring)
+		for s, c := range h.ring[h.head] {
+			h.totals[s] -= c
+			if h.totals[s] <= 0 {
+				delete(h.totals, s)
+			}
+		}
+		h.ring[h.head] = make(map[string]int)
+		h.mu.Unlock()
+	}
+}
+
+// add records one occurrence of status s.
+func (h *statusHistogram) add(s string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.ring[h.head][s]++
+	h.totals[s]++
+}
+
+// snapshot returns a copy of the current rolling counts.
+func (h *statusHistogram) snapshot() map[string]int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	out := make(map[string]int, len(h.totals))
+	for k, v := range h.totals {
+		out[k] = v
+	}
+	return out
+}
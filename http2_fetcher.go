@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"time"
+
+	"golang.org/x/net/http2"
+)
+
+// http2Fetcher issues requests over HTTP/2, negotiated over TLS via
+// ALPN the same way a browser would.
+type http2Fetcher struct {
+	target string
+	client *http.Client
+}
+
+func newHTTP2Fetcher(target string) (Fetcher, error) {
+	return &http2Fetcher{
+		target: target,
+		client: &http.Client{Transport: &http2.Transport{}},
+	}, nil
+}
+
+func (f *http2Fetcher) Fetch(ctx context.Context) (string, time.Duration, error) {
+	ctx, cancel := context.WithTimeout(ctx, requestTimeout())
+	defer cancel()
+	return doHTTPFetch(ctx, f.client, f.target)
+}
+
+// h2cFetcher forces HTTP/2 over plaintext (h2c), for targets that speak
+// HTTP/2 without TLS.
+type h2cFetcher struct {
+	target string
+	client *http.Client
+}
+
+func newH2CFetcher(target string) (Fetcher, error) {
+	return &h2cFetcher{
+		target: target,
+		client: &http.Client{
+			Transport: &http2.Transport{
+				AllowHTTP: true,
+				DialTLSContext: func(ctx context.Context, network, addr string, cfg *tls.Config) (net.Conn, error) {
+					var d net.Dialer
+					return d.DialContext(ctx, network, addr)
+				},
+			},
+		},
+	}, nil
+}
+
+func (f *h2cFetcher) Fetch(ctx context.Context) (string, time.Duration, error) {
+	ctx, cancel := context.WithTimeout(ctx, requestTimeout())
+	defer cancel()
+	return doHTTPFetch(ctx, f.client, f.target)
+}
@@ -0,0 +1,27 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/quic-go/quic-go/http3"
+)
+
+// http3Fetcher issues requests over HTTP/3 (QUIC).
+type http3Fetcher struct {
+	target string
+	client *http.Client
+	rt     *http3.RoundTripper
+}
+
+func newHTTP3Fetcher(target string) (Fetcher, error) {
+	rt := &http3.RoundTripper{}
+	return &http3Fetcher{target: target, client: &http.Client{Transport: rt}, rt: rt}, nil
+}
+
+func (f *http3Fetcher) Fetch(ctx context.Context) (string, time.Duration, error) {
+	ctx, cancel := context.WithTimeout(ctx, requestTimeout())
+	defer cancel()
+	return doHTTPFetch(ctx, f.client, f.target)
+}
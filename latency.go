@@ -0,0 +1,182 @@
+package main
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// latencyBucketCount is the number of exponential buckets used to track
+// request latencies. With buckets spaced from latencyMin to latencyMax,
+// this gives percentile estimates that are good enough for display
+// purposes at O(1) memory and update cost, regardless of QPS.
+const latencyBucketCount = 30
+
+// latencyMin and latencyMax bound the histogram. Samples outside this
+// range are clamped into the first or last bucket.
+const (
+	latencyMin = 100 * time.Microsecond
+	latencyMax = 60 * time.Second
+)
+
+// latencyBounds[i] is the upper bound of bucket i.
+var latencyBounds [latencyBucketCount]time.Duration
+
+func init() {
+	ratio := math.Pow(float64(latencyMax)/float64(latencyMin), 1.0/float64(latencyBucketCount-1))
+	b := float64(latencyMin)
+	for i := range latencyBounds {
+		latencyBounds[i] = time.Duration(b)
+		b *= ratio
+	}
+}
+
+// latencyBucket returns the index of the bucket that d falls into.
+func latencyBucket(d time.Duration) int {
+	for i, bound := range latencyBounds {
+		if d <= bound {
+			return i
+		}
+	}
+	return latencyBucketCount - 1
+}
+
+// latencyHistogram is a rolling histogram of request latencies, backed
+// by a ring of per-second buckets (ringLen of them, sized from
+// --window) that a single janitor goroutine advances, mirroring
+// statusHistogram above.
+type latencyHistogram struct {
+	mu    sync.Mutex
+	ring  [][latencyBucketCount]int64
+	head  int
+	count int64
+	sum   time.Duration
+	min   time.Duration
+	max   time.Duration
+
+	// all mirrors ring's buckets but is never evicted by sweep, so a
+	// --duration run's final summary can report percentiles over the
+	// whole run instead of whatever's left in the rolling --window.
+	all [latencyBucketCount]int64
+}
+
+// latHist is the aggregate latency histogram across all requests; it's
+// created in main once --window is known.
+var latHist *latencyHistogram
+
+func newLatencyHistogram(ringLen int) *latencyHistogram {
+	if ringLen < 1 {
+		ringLen = 1
+	}
+	h := &latencyHistogram{ring: make([][latencyBucketCount]int64, ringLen)}
+	go h.sweep()
+	return h
+}
+
+// sweep advances the ring once a second, dropping the oldest slot.
+func (h *latencyHistogram) sweep() {
+	for range time.Tick(time.Second) {
+		h.mu.Lock()
+		h.head = (h.head + 1) % len(h.ring)
+		h.ring[h.head] = [latencyBucketCount]int64{}
+		h.mu.Unlock()
+	}
+}
+
+// add records one sample's latency.
+func (h *latencyHistogram) add(d time.Duration) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.ring[h.head][latencyBucket(d)]++
+	h.all[latencyBucket(d)]++
+	h.count++
+	h.sum += d
+	if h.min == 0 || d < h.min {
+		h.min = d
+	}
+	if d > h.max {
+		h.max = d
+	}
+}
+
+// latencySnapshot summarizes the histogram for display.
+type latencySnapshot struct {
+	count         int64
+	min, max      time.Duration
+	avg           time.Duration
+	p50, p90, p99 time.Duration
+}
+
+// snapshot computes percentiles over the current rolling window (the
+// sum of all ring slots) alongside the all-time count/min/max/average;
+// it's what the live TUI and /status.json show, labeled accordingly
+// since the two halves cover different time spans. Use finalSnapshot
+// for a report where every field covers the whole run.
+func (h *latencyHistogram) snapshot() latencySnapshot {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	var merged [latencyBucketCount]int64
+	var total int64
+	for _, slot := range h.ring {
+		for i, c := range slot {
+			merged[i] += c
+			total += c
+		}
+	}
+
+	s := latencySnapshot{count: h.count, min: h.min, max: h.max}
+	if h.count > 0 {
+		s.avg = h.sum / time.Duration(h.count)
+	}
+	if total == 0 {
+		return s
+	}
+	s.p50 = percentile(merged, total, 0.50)
+	s.p90 = percentile(merged, total, 0.90)
+	s.p99 = percentile(merged, total, 0.99)
+	return s
+}
+
+// finalSnapshot is like snapshot but computes percentiles over the
+// whole run's never-evicted buckets rather than the rolling --window,
+// so a --duration run's closing report doesn't mix a whole-run
+// count/min/max/average with percentiles from just the last window.
+func (h *latencyHistogram) finalSnapshot() latencySnapshot {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	s := latencySnapshot{count: h.count, min: h.min, max: h.max}
+	if h.count > 0 {
+		s.avg = h.sum / time.Duration(h.count)
+	}
+	if h.count == 0 {
+		return s
+	}
+	s.p50 = percentile(h.all, h.count, 0.50)
+	s.p90 = percentile(h.all, h.count, 0.90)
+	s.p99 = percentile(h.all, h.count, 0.99)
+	return s
+}
+
+// percentile returns the upper bound of the bucket holding the p-th
+// percentile of total samples distributed across buckets. target is
+// ceil'd and floored at 1 so that with a small total (e.g. a single
+// sample in a low-traffic window) it lands on that sample's own bucket
+// instead of truncating to 0, which would match cum's initial value
+// before any bucket is counted and report the lowest bucket bound no
+// matter where the sample actually fell.
+func percentile(buckets [latencyBucketCount]int64, total int64, p float64) time.Duration {
+	target := int64(math.Ceil(p * float64(total)))
+	if target < 1 {
+		target = 1
+	}
+	var cum int64
+	for i, c := range buckets {
+		cum += c
+		if cum >= target {
+			return latencyBounds[i]
+		}
+	}
+	return latencyBounds[latencyBucketCount-1]
+}
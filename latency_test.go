@@ -0,0 +1,39 @@
+package main
+
+import "testing"
+
+func TestPercentileSmallTotal(t *testing.T) {
+	var buckets [latencyBucketCount]int64
+	buckets[25] = 1
+
+	for _, p := range []float64{0.50, 0.90, 0.99} {
+		got := percentile(buckets, 1, p)
+		if want := latencyBounds[25]; got != want {
+			t.Errorf("percentile(single sample in bucket 25, %v) = %v, want %v", p, got, want)
+		}
+	}
+}
+
+func TestPercentileEmpty(t *testing.T) {
+	var buckets [latencyBucketCount]int64
+	if got, want := percentile(buckets, 0, 0.50), latencyBounds[latencyBucketCount-1]; got != want {
+		t.Errorf("percentile(no samples, 0.50) = %v, want %v", got, want)
+	}
+}
+
+func TestPercentileSpreadAcrossBuckets(t *testing.T) {
+	var buckets [latencyBucketCount]int64
+	buckets[0] = 50
+	buckets[10] = 40
+	buckets[20] = 10
+
+	if got, want := percentile(buckets, 100, 0.50), latencyBounds[0]; got != want {
+		t.Errorf("p50 = %v, want %v", got, want)
+	}
+	if got, want := percentile(buckets, 100, 0.90), latencyBounds[10]; got != want {
+		t.Errorf("p90 = %v, want %v", got, want)
+	}
+	if got, want := percentile(buckets, 100, 0.99), latencyBounds[20]; got != want {
+		t.Errorf("p99 = %v, want %v", got, want)
+	}
+}
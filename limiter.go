@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+var burstSize = flag.Int("burst", 1, "maximum burst size for the token-bucket rate limiter")
+
+// pacer hands out tokens at a steady rate.Second/reqQPS cadence via a
+// token bucket, replacing the old once-per-second burst of tickets into
+// workChan. Workers call wait directly instead of reading from a
+// pre-filled channel.
+type pacer struct {
+	lim *rate.Limiter
+
+	mu        sync.Mutex
+	count     int64
+	effective float64
+}
+
+func newPacer() *pacer {
+	p := &pacer{lim: rate.NewLimiter(rate.Limit(sched.QPS()), *burstSize)}
+	go p.run()
+	return p
+}
+
+// run keeps the limiter's rate and burst in sync with the Scheduler and
+// --burst, which can change at any time, and recomputes the measured
+// effective rate once a second.
+func (p *pacer) run() {
+	for range time.Tick(time.Second) {
+		p.lim.SetLimit(rate.Limit(sched.QPS()))
+		p.lim.SetBurst(*burstSize)
+		p.mu.Lock()
+		p.effective = float64(p.count)
+		p.count = 0
+		p.mu.Unlock()
+	}
+}
+
+// wait blocks until a token is available and returns true, or returns
+// false if granting one would mean queueing further than a request's
+// own timeout budget allows. This is how the pacer degrades when
+// workers can't keep up with reqQPS: it drops tokens instead of letting
+// waiters pile up without bound.
+//
+// ReserveN reports OK for any n <= burst regardless of how far out its
+// delay is, so a dropped reservation still has to wait out that budget
+// before returning false — otherwise callers with nothing else to do
+// (like worker's loop) spin back into wait() immediately, burning CPU
+// without making progress instead of backing off.
+func (p *pacer) wait(ctx context.Context) bool {
+	r := p.lim.ReserveN(time.Now(), 1)
+	if !r.OK() {
+		// n=1 exceeds burst (shouldn't happen now that --burst is
+		// validated to be >= 1, but ReserveN gives no delay to wait out
+		// in this case), so back off the same as a dropped reservation
+		// rather than spinning straight back into wait().
+		return p.backoff(ctx)
+	}
+	delay := r.Delay()
+	if delay > requestTimeout() {
+		r.Cancel()
+		return p.backoff(ctx)
+	}
+	t := time.NewTimer(delay)
+	defer t.Stop()
+	select {
+	case <-t.C:
+	case <-ctx.Done():
+		r.Cancel()
+		return false
+	}
+	p.mu.Lock()
+	p.count++
+	p.mu.Unlock()
+	return true
+}
+
+// backoff sleeps for a request's timeout budget (or until ctx is done)
+// before reporting a dropped token, so a caller with nothing else to do
+// doesn't spin straight back into wait().
+func (p *pacer) backoff(ctx context.Context) bool {
+	t := time.NewTimer(requestTimeout())
+	defer t.Stop()
+	select {
+	case <-t.C:
+	case <-ctx.Done():
+	}
+	return false
+}
+
+// measuredRate returns the number of tokens actually handed out over
+// the past second, as opposed to the Scheduler's target.
+func (p *pacer) measuredRate() float64 {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.effective
+}
@@ -1,15 +1,11 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
-	"io/ioutil"
-	"net/http"
 	"os"
-	"os/exec"
 	"sort"
-	"strings"
-	"sync"
 	"sync/atomic"
 	"time"
 
@@ -17,44 +13,115 @@ import (
 )
 
 var numWorkers = flag.Int64("w", 100, "number of concurrent workers")
-var fetcher = flag.String("fetcher", "go", "type of fetcher to use: go|noop|curl")
+var fetcher = flag.String("fetcher", "go", "type of fetcher to use: go|noop|curl|http2|h2c|http3|grpc, or scheme://target to select one inline")
 
 var interval = time.Second
 
-var reqQPS int32 = 1
+// pace is the token-bucket limiter workers pull tickets from; it's set
+// up once in main and read from draw() to show the measured rate.
+var pace *pacer
 
-// This is a histogram of events over the past second.
-var hmu sync.Mutex
-var histogram = make(map[string]int)
+// sched owns the target QPS for the run, either ramping through
+// --stages or following manual arrow-key adjustments.
+var sched *Scheduler
+
+// statusHist is a rolling histogram of status-text counts over the
+// past --window; it's created in main once --window is known.
+var statusHist *statusHistogram
+
+// startWorker spins up one virtual user, in whichever mode main picked:
+// hitting a single URL through a Fetcher, or running a scenario's
+// steps in order.
+var startWorker func(doneChan chan struct{})
 
 func main() {
 	flag.Parse()
-	switch *fetcher {
-	case "go":
-	case "noop":
-	case "curl":
-	default:
-		fmt.Printf("--fetcher set to %q, want one of \"go\", \"noop\", or \"curl\"\n", *fetcher)
+
+	if *burstSize < 1 {
+		fmt.Printf("--burst must be >= 1, got %d\n", *burstSize)
 		os.Exit(1)
 	}
 
-	if flag.NArg() != 1 {
-		fmt.Printf("Usage: hammer [flags] url\n")
-		os.Exit(0)
+	interval = *windowFlag
+	windowSeconds = int(interval.Round(time.Second) / time.Second)
+	statusHist = newStatusHistogram(windowSeconds)
+	latHist = newLatencyHistogram(windowSeconds)
+
+	if *scenarioPath != "" {
+		sc, err := LoadScenario(*scenarioPath)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		startWorker = func(doneChan chan struct{}) { go scenarioWorker(sc, pace, doneChan) }
+	} else {
+		name, target, hasTarget := splitFetcherFlag(*fetcher)
+		switch {
+		case flag.NArg() == 1:
+			// An explicit positional url always wins over a target
+			// embedded in --fetcher.
+			target = flag.Arg(0)
+		case hasTarget:
+			// --fetcher scheme://target supplies the url on its own.
+		default:
+			fmt.Printf("Usage: hammer [flags] url\n")
+			os.Exit(0)
+		}
+		f, err := newFetcher(name, target)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		startWorker = func(doneChan chan struct{}) { go worker(f, pace, doneChan) }
 	}
-	u := flag.Arg(0)
 
-	err := termbox.Init()
+	stages, err := parseStages(*stagesFlag)
 	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	sched = NewScheduler(stages)
+
+	doneChan := make(chan struct{})
+	pace = newPacer()
+
+	if *listenAddr != "" {
+		go startMetricsServer(*listenAddr)
+	}
+
+	if *runDuration > 0 {
+		go func() {
+			time.Sleep(*runDuration)
+			stopAllWorkers(doneChan)
+			if *noTUI {
+				// Headless runs promise a JSON summary on exit, the
+				// same shape /status.json serves, so scripts driving
+				// --no-tui --duration don't need to parse two
+				// different report formats depending on how the run
+				// ended.
+				printFinalSummary()
+			} else {
+				termbox.Close()
+				printBoomSummary()
+			}
+			os.Exit(0)
+		}()
+	}
+
+	if *noTUI {
+		go hammer(doneChan)
+		runHeadless()
+		return
+	}
+
+	if err := termbox.Init(); err != nil {
 		panic(err)
 	}
 	termbox.SetInputMode(termbox.InputEsc | termbox.InputMouse)
 	termbox.Clear(termbox.ColorDefault, termbox.ColorDefault)
 	draw()
 
-	doneChan := make(chan struct{})
-	workChan := make(chan struct{}, 1000000)
-	go hammer(u, workChan, doneChan)
+	go hammer(doneChan)
 	go sendTermboxInterrupts()
 
 	for {
@@ -63,18 +130,16 @@ func main() {
 			switch ev.Key {
 			case termbox.KeyArrowUp:
 				// Increase the target QPS.
-				q := atomic.LoadInt32(&reqQPS)
-				atomic.StoreInt32(&reqQPS, 2*q)
+				sched.SetManual(2 * sched.QPS())
 				draw()
 			case termbox.KeyArrowDown:
 				// Decrease the target QPS.
-				q := atomic.LoadInt32(&reqQPS)
-				atomic.StoreInt32(&reqQPS, q/2)
+				sched.SetManual(sched.QPS() / 2)
 				draw()
 			case termbox.KeyArrowRight:
 				// Add some workers.
 				for i := 0; i < 10; i++ {
-					go worker(u, workChan, doneChan)
+					startWorker(doneChan)
 					atomic.StoreInt64(numWorkers, atomic.LoadInt64(numWorkers)+1)
 				}
 			case termbox.KeyArrowLeft:
@@ -86,6 +151,7 @@ func main() {
 			case termbox.KeyCtrlC:
 				// Quit
 				termbox.Close()
+				printFinalSummary()
 				os.Exit(0)
 			}
 		case termbox.EventInterrupt:
@@ -94,32 +160,27 @@ func main() {
 	}
 }
 
-func hammer(url string, workChan, doneChan chan struct{}) {
-	// Spin up workers.
+func hammer(doneChan chan struct{}) {
+	// Spin up workers. Pacing is now handled by pace itself, which hands
+	// out tokens at a steady rate rather than us bursting reqQPS tickets
+	// into a channel once a second.
 	for i := int64(0); i < atomic.LoadInt64(numWorkers); i++ {
-		go worker(url, workChan, doneChan)
+		startWorker(doneChan)
 	}
+}
 
-	// Feed the work channel reqQPS tickets per second.
-	for _ = range time.Tick(time.Second) {
-		// Drain workChan so we know it's starting from 0.
-	loop:
-		for {
-			select {
-			case <-workChan:
-			default:
-				break loop
-			}
-		}
-
-		// Put QPS work tickets into workChan.
-		for i := int32(0); i < atomic.LoadInt32(&reqQPS); i++ {
-			workChan <- struct{}{}
-		}
+// stopAllWorkers tells every running worker to quit, for a clean exit
+// at the end of a --duration-bounded run.
+func stopAllWorkers(doneChan chan struct{}) {
+	n := atomic.LoadInt64(numWorkers)
+	for i := int64(0); i < n; i++ {
+		doneChan <- struct{}{}
 	}
+	atomic.StoreInt64(numWorkers, 0)
 }
 
-func worker(url string, workChan chan struct{}, doneChan chan struct{}) {
+func worker(f Fetcher, pace *pacer, doneChan chan struct{}) {
+	ctx := context.Background()
 	for {
 		// Quit if the done chan says so.
 		select {
@@ -128,66 +189,32 @@ func worker(url string, workChan chan struct{}, doneChan chan struct{}) {
 		default:
 		}
 
-		// Wait until there's work to do.
-		<-workChan
-
-		// Do some work.
-		switch *fetcher {
-		case "curl":
-			cmd := exec.Command("curl", "-s", "-S", url)
-			out, _ := cmd.CombinedOutput()
-			addToHistogram(string(out))
-		case "go":
-			client := http.Client{Timeout: time.Duration(requestTimeout())}
-			resp, err := client.Get(url)
-			if resp != nil {
-				// Read it, just in case that matters somehow.
-				if _, err := ioutil.ReadAll(resp.Body); err != nil {
-					addToHistogram(fmt.Sprintf("Failed to read response body: %v", err))
-					continue
-				}
-				if err := resp.Body.Close(); err != nil {
-					addToHistogram(fmt.Sprintf("Failed to close response body: %v", err))
-					continue
-				}
-			}
-			// status text
-			var st string
-			if err != nil {
-				parts := strings.Split(err.Error(), ": ")
-				st = parts[len(parts)-1]
-			} else {
-				st = http.StatusText(resp.StatusCode)
-			}
-			addToHistogram(st)
-		case "noop":
-			addToHistogram("Did nothing")
-		default:
-			addToHistogram(fmt.Sprintf("Unrecognized value for --fetcher: %q\n", *fetcher))
+		// Wait for a token before doing any work.
+		if !pace.wait(ctx) {
+			continue
+		}
+
+		atomic.AddInt64(&inflight, 1)
+		status, latency, err := f.Fetch(ctx)
+		atomic.AddInt64(&inflight, -1)
+		latHist.add(latency)
+		if err != nil {
+			status = err.Error()
 		}
+		recordResult(status, latency)
+		addToHistogram(status)
 	}
 }
 
-// addToHistogram increments the given string in the histogram and then
-// decrements it again after a second.
+// addToHistogram records one occurrence of s in the rolling status
+// histogram.
 func addToHistogram(s string) {
-	hmu.Lock()
-	defer hmu.Unlock()
-	histogram[s]++
-	go func() {
-		<-time.After(time.Second)
-		hmu.Lock()
-		defer hmu.Unlock()
-		histogram[s]--
-		if histogram[s] == 0 {
-			delete(histogram, s)
-		}
-	}()
+	statusHist.add(s)
 }
 
 // requestTimeout calculates how long workers should spend on each request.
 func requestTimeout() time.Duration {
-	d := time.Duration(float64(time.Second) * (float64(atomic.LoadInt64(numWorkers)) / float64(atomic.LoadInt32(&reqQPS))))
+	d := time.Duration(float64(time.Second) * (float64(atomic.LoadInt64(numWorkers)) / sched.QPS()))
 	if d > time.Second {
 		d = time.Second
 	}
@@ -206,27 +233,32 @@ func draw() {
 	// Do the actual drawing.
 	termbox.Clear(termbox.ColorDefault, termbox.ColorDefault)
 	y := 0
-	tbprint(0, y, termbox.ColorWhite, termbox.ColorDefault, fmt.Sprintf("Target QPS: %d", atomic.LoadInt32(&reqQPS)))
+	tbprint(0, y, termbox.ColorWhite, termbox.ColorDefault, fmt.Sprintf("Target QPS: %v (effective: %v)", sched.QPS(), pace.measuredRate()))
 	y++
 	tbprint(0, y, termbox.ColorWhite, termbox.ColorDefault, fmt.Sprintf("%d workers", atomic.LoadInt64(numWorkers)))
 	y++
 	tbprint(0, y, termbox.ColorWhite, termbox.ColorDefault, fmt.Sprintf("Request timeout: %v", requestTimeout()))
 	y++
 	y++
-	hmu.Lock()
-	defer hmu.Unlock()
-	if len(histogram) == 0 {
+	ls := latHist.snapshot()
+	tbprint(0, y, termbox.ColorWhite, termbox.ColorDefault, fmt.Sprintf("Latency (all-time): min %v / avg %v / max %v", ls.min, ls.avg, ls.max))
+	y++
+	tbprint(0, y, termbox.ColorWhite, termbox.ColorDefault, fmt.Sprintf("Percentiles (past %v): p50 %v / p90 %v / p99 %v", interval, ls.p50, ls.p90, ls.p99))
+	y++
+	y++
+	snap := statusHist.snapshot()
+	if len(snap) == 0 {
 		tbprint(0, y, termbox.ColorWhite, termbox.ColorDefault, fmt.Sprintf("No responses in past %v", interval))
 	} else {
 		tbprint(0, y, termbox.ColorWhite, termbox.ColorDefault, fmt.Sprintf("Responses in past %v:", interval))
 		y++
-		var keys []string
-		for k := range histogram {
+		keys := make([]string, 0, len(snap))
+		for k := range snap {
 			keys = append(keys, k)
 		}
 		sort.Strings(keys)
 		for _, k := range keys {
-			msg := fmt.Sprintf("  %s: %d", k, histogram[k])
+			msg := fmt.Sprintf("  %s: %d", k, snap[k])
 			tbprint(0, y, termbox.ColorWhite, termbox.ColorDefault, msg)
 			y++
 		}
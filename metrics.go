@@ -0,0 +1,152 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+var listenAddr = flag.String("listen", "", "address to serve Prometheus metrics on /metrics and status on /status.json, e.g. :9090")
+var noTUI = flag.Bool("no-tui", false, "run headless instead of starting the termbox UI; pairs well with --listen, for driving hammer from CI or a script")
+
+var (
+	requestsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "hammer_requests_total",
+		Help: "Total number of completed requests, by status.",
+	}, []string{"status"})
+	requestDuration = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "hammer_request_duration_seconds",
+		Help:    "Request latency in seconds.",
+		Buckets: prometheus.ExponentialBuckets(0.0001, 2, 20),
+	})
+	workersGauge   = prometheus.NewGauge(prometheus.GaugeOpts{Name: "hammer_workers", Help: "Current number of worker goroutines."})
+	targetQPSGauge = prometheus.NewGauge(prometheus.GaugeOpts{Name: "hammer_target_qps", Help: "Target requests per second."})
+	inflightGauge  = prometheus.NewGauge(prometheus.GaugeOpts{Name: "hammer_inflight", Help: "Requests currently in flight."})
+)
+
+func init() {
+	prometheus.MustRegister(requestsTotal, requestDuration, workersGauge, targetQPSGauge, inflightGauge)
+}
+
+// inflight counts requests that have been handed a pace token but
+// haven't completed yet.
+var inflight int64
+
+// recordResult feeds one completed request into both the termbox
+// histogram/latency tracking and the Prometheus metrics, so headless
+// and interactive runs report the same numbers.
+func recordResult(status string, latency time.Duration) {
+	requestsTotal.WithLabelValues(status).Inc()
+	requestDuration.Observe(latency.Seconds())
+}
+
+// startMetricsServer serves /metrics and /status.json on listenAddr
+// until the process exits. It also keeps workersGauge/targetQPSGauge in
+// sync, since those can change at any time via the UI.
+func startMetricsServer(addr string) {
+	go func() {
+		for range time.Tick(time.Second) {
+			workersGauge.Set(float64(atomic.LoadInt64(numWorkers)))
+			targetQPSGauge.Set(sched.QPS())
+			inflightGauge.Set(float64(atomic.LoadInt64(&inflight)))
+		}
+	}()
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.Handler())
+	mux.HandleFunc("/status.json", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(buildStatus())
+	})
+	if err := http.ListenAndServe(addr, mux); err != nil {
+		fmt.Printf("--listen server on %s failed: %v\n", addr, err)
+		os.Exit(1)
+	}
+}
+
+// statusJSON is the payload served from /status.json; it carries the
+// same work-queue and histogram data the termbox UI shows.
+type statusJSON struct {
+	TargetQPS    float64                `json:"target_qps"`
+	EffectiveQPS float64                `json:"effective_qps"`
+	Workers      int64                  `json:"workers"`
+	Inflight     int64                  `json:"inflight"`
+	Latency      latencyJSON            `json:"latency"`
+	Histogram    map[string]int         `json:"histogram"`
+	StepLatency  map[string]latencyJSON `json:"step_latency,omitempty"`
+}
+
+// latencyJSON mirrors the TUI's latency line: Count/Min/Max/Avg are
+// all-time (never reset by the rolling --window), while P50/P90/P99
+// cover only the past --window, same as latencyHistogram.snapshot.
+type latencyJSON struct {
+	Count int64         `json:"count"`
+	Min   time.Duration `json:"min_ns"`
+	Max   time.Duration `json:"max_ns"`
+	Avg   time.Duration `json:"avg_ns"`
+	P50   time.Duration `json:"p50_ns"`
+	P90   time.Duration `json:"p90_ns"`
+	P99   time.Duration `json:"p99_ns"`
+}
+
+func toLatencyJSON(ls latencySnapshot) latencyJSON {
+	return latencyJSON{
+		Count: ls.count,
+		Min:   ls.min,
+		Max:   ls.max,
+		Avg:   ls.avg,
+		P50:   ls.p50,
+		P90:   ls.p90,
+		P99:   ls.p99,
+	}
+}
+
+func buildStatus() statusJSON {
+	hist := statusHist.snapshot()
+	var stepLatency map[string]latencyJSON
+	if snap := stepLatencySnapshot(); len(snap) > 0 {
+		stepLatency = make(map[string]latencyJSON, len(snap))
+		for name, ls := range snap {
+			stepLatency[name] = toLatencyJSON(ls)
+		}
+	}
+	return statusJSON{
+		TargetQPS:    sched.QPS(),
+		EffectiveQPS: pace.measuredRate(),
+		Workers:      atomic.LoadInt64(numWorkers),
+		Inflight:     atomic.LoadInt64(&inflight),
+		Latency:      toLatencyJSON(latHist.snapshot()),
+		Histogram:    hist,
+		StepLatency:  stepLatency,
+	}
+}
+
+// runHeadless replaces the termbox event loop in --no-tui mode: it just
+// waits for an interrupt or terminate signal, prints a final summary,
+// and exits.
+func runHeadless() {
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, os.Interrupt, syscall.SIGTERM)
+	<-sigCh
+	printFinalSummary()
+	os.Exit(0)
+}
+
+// printFinalSummary writes a boom-style JSON summary to stdout.
+func printFinalSummary() {
+	b, err := json.MarshalIndent(buildStatus(), "", "  ")
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	fmt.Println(string(b))
+}
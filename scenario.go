@@ -0,0 +1,208 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+var scenarioPath = flag.String("scenario", "", "path to a YAML scenario file; when set, each worker runs the scenario's steps in order against a virtual user instead of hitting a single URL")
+
+// Scenario is an ordered sequence of Steps a virtual user runs,
+// sleeping Step.Think between each and carrying variables captured by
+// Extract forward into later steps' templates.
+type Scenario struct {
+	Steps []Step `yaml:"steps"`
+}
+
+// Step is one HTTP call in a Scenario. URL, Headers, and Body may
+// reference variables captured by earlier steps as {{name}}.
+type Step struct {
+	Name    string            `yaml:"name"`
+	Method  string            `yaml:"method"`
+	URL     string            `yaml:"url"`
+	Headers map[string]string `yaml:"headers"`
+	Body    string            `yaml:"body"`
+	Think   time.Duration     `yaml:"think"`
+	Extract []Extraction      `yaml:"extract"`
+}
+
+// Extraction captures one variable from a step's response body, via
+// either a dotted JSON path (e.g. "data.token") or the first submatch
+// of a regular expression.
+type Extraction struct {
+	Var      string `yaml:"var"`
+	JSONPath string `yaml:"jsonpath"`
+	Regex    string `yaml:"regex"`
+}
+
+// LoadScenario reads and parses a scenario file.
+func LoadScenario(path string) (*Scenario, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var sc Scenario
+	if err := yaml.Unmarshal(b, &sc); err != nil {
+		return nil, fmt.Errorf("parsing scenario %s: %w", path, err)
+	}
+	return &sc, nil
+}
+
+var varPattern = regexp.MustCompile(`\{\{(\w+)\}\}`)
+
+// expand substitutes {{var}} references in s with values from vars.
+func expand(s string, vars map[string]string) string {
+	return varPattern.ReplaceAllStringFunc(s, func(m string) string {
+		return vars[varPattern.FindStringSubmatch(m)[1]]
+	})
+}
+
+// runStep executes one step, updating vars with anything it extracts.
+func runStep(ctx context.Context, step Step, vars map[string]string) (status string, latency time.Duration, err error) {
+	method := step.Method
+	if method == "" {
+		method = http.MethodGet
+	}
+	var body []byte
+	if step.Body != "" {
+		body = []byte(expand(step.Body, vars))
+	}
+	ctx, cancel := context.WithTimeout(ctx, requestTimeout())
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, method, expand(step.URL, vars), bytes.NewReader(body))
+	if err != nil {
+		return "", 0, err
+	}
+	for k, v := range step.Headers {
+		req.Header.Set(k, expand(v, vars))
+	}
+
+	start := time.Now()
+	resp, err := http.DefaultClient.Do(req)
+	latency = time.Since(start)
+	if err != nil {
+		return errStatus(err), latency, nil
+	}
+	defer resp.Body.Close()
+	respBody, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Sprintf("Failed to read response body: %v", err), latency, nil
+	}
+
+	for _, e := range step.Extract {
+		if v, ok := extract(e, respBody); ok {
+			vars[e.Var] = v
+		}
+	}
+	return http.StatusText(resp.StatusCode), latency, nil
+}
+
+// extract pulls one variable out of a response body.
+func extract(e Extraction, body []byte) (string, bool) {
+	if e.Regex != "" {
+		re, err := regexp.Compile(e.Regex)
+		if err != nil {
+			return "", false
+		}
+		m := re.FindSubmatch(body)
+		if len(m) < 2 {
+			return "", false
+		}
+		return string(m[1]), true
+	}
+	if e.JSONPath != "" {
+		var v interface{}
+		if err := json.Unmarshal(body, &v); err != nil {
+			return "", false
+		}
+		for _, part := range strings.Split(e.JSONPath, ".") {
+			m, ok := v.(map[string]interface{})
+			if !ok {
+				return "", false
+			}
+			if v, ok = m[part]; !ok {
+				return "", false
+			}
+		}
+		return fmt.Sprintf("%v", v), true
+	}
+	return "", false
+}
+
+// scenarioWorker runs sc's steps in order once per pace token, looping
+// until doneChan says to stop. Each step's outcome is recorded to the
+// histogram under its own "name: status" label, and its latency to a
+// histogram scoped to that step, so the UI shows per-step breakdowns
+// rather than one number for the whole scenario.
+func scenarioWorker(sc *Scenario, pace *pacer, doneChan chan struct{}) {
+	ctx := context.Background()
+	for {
+		select {
+		case <-doneChan:
+			return
+		default:
+		}
+		if !pace.wait(ctx) {
+			continue
+		}
+
+		vars := make(map[string]string)
+		for i, step := range sc.Steps {
+			if i > 0 && step.Think > 0 {
+				time.Sleep(step.Think)
+			}
+			atomic.AddInt64(&inflight, 1)
+			status, latency, err := runStep(ctx, step, vars)
+			atomic.AddInt64(&inflight, -1)
+			if err != nil {
+				status = err.Error()
+			}
+			label := fmt.Sprintf("%s: %s", step.Name, status)
+			latencyFor(step.Name).add(latency)
+			recordResult(label, latency)
+			addToHistogram(label)
+		}
+	}
+}
+
+var stepLatMu sync.Mutex
+var stepLat = make(map[string]*latencyHistogram)
+
+// latencyFor returns (creating if needed) the rolling latency histogram
+// for one scenario step.
+func latencyFor(step string) *latencyHistogram {
+	stepLatMu.Lock()
+	defer stepLatMu.Unlock()
+	h, ok := stepLat[step]
+	if !ok {
+		h = newLatencyHistogram(windowSeconds)
+		stepLat[step] = h
+	}
+	return h
+}
+
+// stepLatencySnapshot returns the current rolling-window latency
+// snapshot for every scenario step seen so far, keyed by step name, for
+// /status.json to report alongside the per-step "name: status" counts
+// already in the status histogram. Empty outside --scenario mode.
+func stepLatencySnapshot() map[string]latencySnapshot {
+	stepLatMu.Lock()
+	defer stepLatMu.Unlock()
+	snap := make(map[string]latencySnapshot, len(stepLat))
+	for name, h := range stepLat {
+		snap[name] = h.snapshot()
+	}
+	return snap
+}
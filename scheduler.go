@@ -0,0 +1,140 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+var stagesFlag = flag.String("stages", "", "ramp schedule as time:qps waypoints, e.g. 0:1,30s:100,60s:1000,120s:1000; QPS is interpolated linearly between them")
+var runDuration = flag.Duration("duration", 0, "stop all workers and print a final summary after this long; 0 means run until interrupted")
+
+// stage is one waypoint in a ramp schedule: at time offset T from the
+// start of the run, the target QPS should be QPS.
+type stage struct {
+	T   time.Duration
+	QPS float64
+}
+
+// parseStages parses a --stages value like "0:1,30s:100,60s:1000". An
+// empty string yields no stages, meaning QPS stays under manual
+// (arrow-key) control.
+func parseStages(s string) ([]stage, error) {
+	if s == "" {
+		return nil, nil
+	}
+	var stages []stage
+	for _, part := range strings.Split(s, ",") {
+		fields := strings.SplitN(part, ":", 2)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("bad --stages waypoint %q, want time:qps", part)
+		}
+		t, err := time.ParseDuration(fields[0])
+		if err != nil && fields[0] != "0" {
+			return nil, fmt.Errorf("bad --stages offset %q: %w", fields[0], err)
+		}
+		qps, err := strconv.ParseFloat(fields[1], 64)
+		if err != nil {
+			return nil, fmt.Errorf("bad --stages QPS %q: %w", fields[1], err)
+		}
+		stages = append(stages, stage{T: t, QPS: qps})
+	}
+	sort.Slice(stages, func(i, j int) bool { return stages[i].T < stages[j].T })
+	return stages, nil
+}
+
+// Scheduler owns the target QPS for the whole run: either a linear
+// ramp between --stages waypoints, or a manually-set rate driven by the
+// UI's arrow keys. The pacer consults it once a second instead of
+// reqQPS living as a bare global atomic.
+type Scheduler struct {
+	stages []stage
+	start  time.Time
+
+	manualBits uint64 // atomic bit-packed float64, used when stages is empty
+}
+
+// NewScheduler builds a Scheduler for the given ramp schedule (may be
+// nil for pure manual control) and starts its clock now.
+func NewScheduler(stages []stage) *Scheduler {
+	s := &Scheduler{stages: stages, start: time.Now()}
+	s.SetManual(1)
+	return s
+}
+
+// SetManual sets the manually-driven QPS. It has no effect once a ramp
+// schedule is configured.
+func (s *Scheduler) SetManual(q float64) {
+	if q < 0 {
+		q = 0
+	}
+	atomic.StoreUint64(&s.manualBits, math.Float64bits(q))
+}
+
+// Manual returns the last manually-set QPS.
+func (s *Scheduler) Manual() float64 {
+	return math.Float64frombits(atomic.LoadUint64(&s.manualBits))
+}
+
+// QPS returns the current target rate.
+func (s *Scheduler) QPS() float64 {
+	if len(s.stages) == 0 {
+		return s.Manual()
+	}
+	return s.targetAt(time.Since(s.start))
+}
+
+// targetAt linearly interpolates the target QPS at elapsed time t,
+// holding steady at the first waypoint before the ramp starts and at
+// the last one once it's done.
+func (s *Scheduler) targetAt(t time.Duration) float64 {
+	if t <= s.stages[0].T {
+		return s.stages[0].QPS
+	}
+	last := s.stages[len(s.stages)-1]
+	if t >= last.T {
+		return last.QPS
+	}
+	for i := 1; i < len(s.stages); i++ {
+		a, b := s.stages[i-1], s.stages[i]
+		if t <= b.T {
+			frac := float64(t-a.T) / float64(b.T-a.T)
+			return a.QPS + frac*(b.QPS-a.QPS)
+		}
+	}
+	return last.QPS
+}
+
+// printBoomSummary prints a boom-style final report: total requests,
+// timing stats, throughput, and the status/latency breakdown for the
+// run, in the vein of the summaries load generators like boom print at
+// exit.
+func printBoomSummary() {
+	ls := latHist.finalSnapshot()
+	fmt.Println()
+	fmt.Println("Summary:")
+	fmt.Printf("  Total:\t%d requests\n", ls.count)
+	fmt.Printf("  Slowest:\t%v\n", ls.max)
+	fmt.Printf("  Fastest:\t%v\n", ls.min)
+	fmt.Printf("  Average:\t%v\n", ls.avg)
+	fmt.Printf("  Requests/sec:\t%.2f\n", pace.measuredRate())
+	fmt.Println()
+	fmt.Println("Latency distribution:")
+	fmt.Printf("  p50:\t%v\n  p90:\t%v\n  p99:\t%v\n", ls.p50, ls.p90, ls.p99)
+	fmt.Println()
+	fmt.Println("Status code distribution:")
+	snap := statusHist.snapshot()
+	keys := make([]string, 0, len(snap))
+	for k := range snap {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		fmt.Printf("  [%s]\t%d responses\n", k, snap[k])
+	}
+}